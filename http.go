@@ -4,8 +4,7 @@ package logtap
 
 import (
 	"errors"
-	"github.com/upworthy/go-telemetry"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
@@ -65,12 +64,26 @@ func GetAppName(r *http.Request) (interface{}, error) {
 // request. By default, context will be nil. Context may be
 // arbitrarily customized by setting ContextGetter field.
 //
-// Handler reports its operational state via Metrics. Metrics field
-// may be set to customize how telemetry data is processed.
+// Handler reports its operational state via Telemetry. Telemetry field
+// may be set to customize how telemetry data is processed; it defaults
+// to LogTelemetry.
+//
+// Handler logs via Logger, which defaults to slog.Default(). Every
+// record it emits carries the drain token, app name and expected
+// message count for the request that produced it, and the message count
+// mismatch record also carries the actual count, so that Logger may be
+// swapped for one that writes structured, filterable output.
+//
+// If Pipeline is set, ServeHTTP submits each batch to it instead of
+// calling F synchronously, and answers 202 once the batch is queued or
+// 503 if Pipeline.Submit rejects it, rather than blocking the request
+// goroutine until F returns.
 type Handler struct {
-	telemetry.Metrics
+	Telemetry
 	ContextGetter
-	F func([]*SyslogMessage, interface{})
+	F        func([]*SyslogMessage, interface{})
+	Logger   *slog.Logger
+	Pipeline *Pipeline
 }
 
 // NewHandler creates a new instance of the log tapping endpoint that
@@ -78,41 +91,62 @@ type Handler struct {
 // messages.
 func NewHandler(f func([]*SyslogMessage, interface{})) *Handler {
 	h := Handler{
-		telemetry.LogMetrics,
+		LogTelemetry,
 		ContextFunc(NilContext),
 		f,
+		slog.Default(),
+		nil,
 	}
 	return &h
 }
 
 // ServeHTTP implements the log tapping endpoint logic.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := h.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	expectedCount, _ := strconv.Atoi(r.Header.Get("Logplex-Msg-Count"))
+	logger = logger.With(
+		"drain_token", r.Header.Get("Logplex-Drain-Token"),
+		"app", r.URL.Query().Get("app"),
+		"msg_count_expected", expectedCount,
+	)
+	tagged := h.Telemetry.With(
+		"drain_token", r.Header.Get("Logplex-Drain-Token"),
+		"app", r.URL.Query().Get("app"),
+	)
 	if ctx, err := h.ContextGetter.GetContext(r); err != nil {
 		http.Error(w, err.Error(), http.StatusTeapot)
 		h.Count(1, "context error")
 	} else {
 		var results []*SyslogMessage
-		expectedCount, _ := strconv.Atoi(r.Header.Get("Logplex-Msg-Count"))
 		if expectedCount > 0 && expectedCount <= 10 {
 			// empirical evidence suggests that the upper bound of messages per Logplex request is 10.
 			results = make([]*SyslogMessage, 0, expectedCount)
 		}
-		results, errors := ReadSyslogMessages(results, r.Body)
+		results, errors := ReadSyslogMessages(results, r.Body, logger)
 		if len(results) != 0 {
-			h.F(results, ctx)
+			if h.Pipeline != nil {
+				if h.Pipeline.Submit(results, ctx) {
+					w.WriteHeader(http.StatusAccepted)
+				} else {
+					http.Error(w, "queue is full", http.StatusServiceUnavailable)
+				}
+			} else {
+				h.F(results, ctx)
+			}
 		}
 		for _, x := range results {
-			h.Value(time.Since(x.Timestamp).Seconds(), "time lag")
-		}
-		for _, e := range errors {
-			log.Print(e)
+			tagged.With("hostname", x.Hostname).Value(time.Since(x.Timestamp).Seconds(), "time lag")
 		}
-		h.Count(1, "request")
+		_ = errors // parse errors were already logged by ReadSyslogMessages
+		tagged.Count(1, "request")
 		if expectedCount > 0 {
 			if len(results) != expectedCount {
-				log.Printf("Logplex-Msg-Count is %v, but %v messages have been read", expectedCount, len(results))
+				logger.Warn("message count mismatch", "msg_count_actual", len(results))
 			}
-			h.Value(expectedCount-len(results), "message count delta")
+			tagged.Value(expectedCount-len(results), "message count delta")
 		}
 	}
 }
@@ -39,7 +39,7 @@ func TestHandlerServeHTTP(t *testing.T) {
 	r.Header.Set("Logplex-Msg-Count", "3")
 	w := httptest.NewRecorder()
 	var actual *SyslogMessage
-	f := func(m *SyslogMessage) { actual = m }
+	f := func(ms []*SyslogMessage, ctx interface{}) { actual = ms[0] }
 	h := NewHandler(f)
 	h.Telemetry = DiscardTelemetry
 	h.ServeHTTP(w, r)
@@ -55,7 +55,6 @@ func TestHandlerServeHTTP(t *testing.T) {
 		Procid:    "api",
 		Msgid:     "-",
 		Text:      "Release v1822 created by foo@example.com",
-		Context:   nil,
 	}
 	if !reflect.DeepEqual(actual, expected) {
 		t.Errorf("%#v != %#v", actual, expected)
@@ -66,7 +65,7 @@ func TestHandlerServeHTTPFailsWithoutContext(t *testing.T) {
 	d := strings.NewReader("97 <45>1 2014-01-09T20:34:44.693891+00:00 host heroku api - Release v1822 created by foo@example.com")
 	r, _ := http.NewRequest("POST", "https://logtap.example.org/", d)
 	w := httptest.NewRecorder()
-	f := func(*SyslogMessage) {}
+	f := func([]*SyslogMessage, interface{}) {}
 	h := NewHandler(f)
 	h.ContextGetter = ContextFunc(GetAppName)
 	h.ServeHTTP(w, r)
@@ -0,0 +1,263 @@
+package logtap
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+)
+
+// ConnContextGetter is the net.Conn analogue of ContextGetter: it
+// derives connection-scoped context (e.g. peer address, client cert
+// CN) from an accepted connection, once per connection.
+type ConnContextGetter interface {
+	GetConnContext(conn net.Conn) (interface{}, error)
+}
+
+// ConnContextFunc type is an adapter to allow the use of ordinary
+// functions as ConnContextGetter-s.
+type ConnContextFunc func(conn net.Conn) (interface{}, error)
+
+// GetConnContext calls f(conn).
+func (f ConnContextFunc) GetConnContext(conn net.Conn) (interface{}, error) {
+	return f(conn)
+}
+
+// NilConnContext is for situations when connection-specific context is
+// not needed.
+func NilConnContext(net.Conn) (interface{}, error) {
+	return nil, nil
+}
+
+// GetPeerAddr returns the remote address of the connection.
+func GetPeerAddr(conn net.Conn) (interface{}, error) {
+	return conn.RemoteAddr().String(), nil
+}
+
+var errNotTLS = errors.New("connection is not TLS")
+var errNoPeerCertificate = errors.New("TLS connection has no peer certificate")
+
+// GetPeerCertCN performs the TLS handshake (if it hasn't happened
+// already) and returns the CommonName of the first certificate the
+// peer presented. It fails if conn isn't a *tls.Conn configured to
+// request client certificates.
+func GetPeerCertCN(conn net.Conn) (interface{}, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, errNotTLS
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	peerCerts := tlsConn.ConnectionState().PeerCertificates
+	if len(peerCerts) == 0 {
+		return nil, errNoPeerCertificate
+	}
+	return peerCerts[0].Subject.CommonName, nil
+}
+
+// DefaultMaxFrameBytes is the frame size ceiling used when
+// Listener.MaxFrameBytes is zero. It matches the uint16 ceiling that
+// ReadSyslogMessages' octet-counting framing has always had.
+const DefaultMaxFrameBytes = 65535
+
+// A Listener is a log tapping endpoint analogous to Handler, but for
+// syslog sources (syslog-ng, rsyslog, logshuttle, sidecar agents) that
+// connect over TCP or TLS directly instead of going through a Logplex
+// HTTP drain.
+//
+// Listener accepts framing using either octet-counting
+// (draft-gerhards-syslog-plain-tcp) or non-transparent, LF-delimited
+// framing (RFC6587 section 3.4.2), auto-detected per connection from
+// its first byte. Frames larger than MaxFrameBytes (DefaultMaxFrameBytes
+// if zero) are rejected.
+//
+// Each successfully parsed syslog message is passed to F, one message
+// per call, along with "context" derived from the connection via
+// ConnContextGetter. By default, context will be nil.
+//
+// Listener reports its operational state via Telemetry and logs via
+// Logger; both default the same way Handler's do.
+type Listener struct {
+	Telemetry
+	ConnContextGetter
+	F             func([]*SyslogMessage, interface{})
+	Logger        *slog.Logger
+	MaxFrameBytes int
+}
+
+// NewListener creates a new instance of the log tapping listener that
+// will invoke f for each successfully parsed syslog message.
+func NewListener(f func([]*SyslogMessage, interface{})) *Listener {
+	return &Listener{
+		LogTelemetry,
+		ConnContextFunc(NilConnContext),
+		f,
+		slog.Default(),
+		DefaultMaxFrameBytes,
+	}
+}
+
+// Serve accepts connections from l until Accept returns an error (for
+// instance because l was closed), handling each accepted connection on
+// its own goroutine. Serve always returns a non-nil error.
+func (ln *Listener) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go ln.handle(conn)
+	}
+}
+
+func (ln *Listener) handle(conn net.Conn) {
+	defer conn.Close()
+
+	logger := ln.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = logger.With("remote_addr", conn.RemoteAddr().String())
+	tagged := ln.Telemetry.With("remote_addr", conn.RemoteAddr().String())
+	tagged.Count(1, "conn accept")
+
+	ctx, err := ln.ConnContextGetter.GetConnContext(conn)
+	if err != nil {
+		logger.Warn("connection context error", "err", err)
+		tagged.Count(1, "conn error")
+		return
+	}
+
+	cr := &countingReader{r: conn}
+	maxFrameBytes := ln.MaxFrameBytes
+	if maxFrameBytes <= 0 {
+		maxFrameBytes = DefaultMaxFrameBytes
+	}
+	err = scanSyslogFrames(cr, maxFrameBytes, func(frame []byte, frameOffset int64) {
+		if m, err := ParseSyslogMessage(frame); err == nil {
+			ln.F([]*SyslogMessage{m}, ctx)
+		} else {
+			logger.Warn("syslog message parse error",
+				"err", err,
+				"frame_offset", frameOffset,
+				"frame_preview", hexPreview(frame),
+			)
+		}
+	})
+	tagged.Value(cr.n, "bytes")
+	if err != nil && err != io.EOF {
+		logger.Warn("connection error", "err", err)
+		tagged.Count(1, "conn error")
+	}
+}
+
+// countingReader wraps an io.Reader, tallying the number of bytes read
+// through it so Listener can report a "bytes" telemetry value.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// octetCountingSplit returns a bufio.SplitFunc that implements the
+// octet-counting framing from draft-gerhards-syslog-plain-tcp section
+// 3.4.1: "MSG-LEN SP MSG". It rejects any MSG-LEN greater than
+// maxFrameBytes.
+func octetCountingSplit(maxFrameBytes int) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		i := bytes.IndexByte(data, ' ')
+		if i < 0 {
+			if atEOF {
+				return 0, nil, errors.New("truncated octet-counting frame")
+			}
+			return 0, nil, nil
+		}
+		size, err := strconv.Atoi(string(data[:i]))
+		if err != nil {
+			return 0, nil, err
+		}
+		if size > maxFrameBytes {
+			return 0, nil, fmt.Errorf("frame of %d bytes exceeds MaxFrameBytes (%d)", size, maxFrameBytes)
+		}
+		if len(data)-i-1 < size {
+			if atEOF {
+				return 0, nil, errors.New("truncated octet-counting frame")
+			}
+			return 0, nil, nil
+		}
+		return i + 1 + size, data[i+1 : i+1+size], nil
+	}
+}
+
+// lfFramingSplit returns a bufio.SplitFunc that implements the
+// non-transparent, LF-delimited framing from RFC6587 section 3.4.2:
+// each frame is terminated by (and excludes) a trailing '\n'.
+func lfFramingSplit(maxFrameBytes int) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			if i > maxFrameBytes {
+				return 0, nil, fmt.Errorf("frame of %d bytes exceeds MaxFrameBytes (%d)", i, maxFrameBytes)
+			}
+			return i + 1, data[:i], nil
+		}
+		if len(data) > maxFrameBytes {
+			return 0, nil, fmt.Errorf("frame of more than %d bytes has no terminator", maxFrameBytes)
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// scanSyslogFrames reads length-delimited syslog frames from r,
+// auto-detecting octet-counting vs. non-transparent LF framing from
+// the first byte (an ASCII digit means octet-counting), and invokes
+// onFrame with each frame and its byte offset within r. It returns the
+// first error encountered, which is io.EOF on a clean end of stream.
+func scanSyslogFrames(r io.Reader, maxFrameBytes int, onFrame func(frame []byte, frameOffset int64)) error {
+	br := bufio.NewReader(r)
+	first, err := br.Peek(1)
+	if err != nil {
+		return err
+	}
+	split := lfFramingSplit(maxFrameBytes)
+	if first[0] >= '0' && first[0] <= '9' {
+		split = octetCountingSplit(maxFrameBytes)
+	}
+	var offset, frameOffset int64
+	s := bufio.NewScanner(br)
+	s.Buffer(make([]byte, 4096), maxFrameBytes+64)
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		if token != nil {
+			frameOffset = offset
+		}
+		offset += int64(advance)
+		return advance, token, err
+	})
+	for s.Scan() {
+		onFrame(s.Bytes(), frameOffset)
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
@@ -0,0 +1,45 @@
+package logtap
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestScanSyslogFramesOctetCounting(t *testing.T) {
+	var frames []string
+	r := strings.NewReader("5 hello3 hi!")
+	err := scanSyslogFrames(r, DefaultMaxFrameBytes, func(frame []byte, frameOffset int64) {
+		frames = append(frames, string(frame))
+	})
+	if err != io.EOF {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"hello", "hi!"}
+	if len(frames) != len(expected) || frames[0] != expected[0] || frames[1] != expected[1] {
+		t.Errorf("%#v != %#v", frames, expected)
+	}
+}
+
+func TestScanSyslogFramesLF(t *testing.T) {
+	var frames []string
+	r := strings.NewReader("<45>1 hello\n<45>1 world\n")
+	err := scanSyslogFrames(r, DefaultMaxFrameBytes, func(frame []byte, frameOffset int64) {
+		frames = append(frames, string(frame))
+	})
+	if err != io.EOF {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"<45>1 hello", "<45>1 world"}
+	if len(frames) != len(expected) || frames[0] != expected[0] || frames[1] != expected[1] {
+		t.Errorf("%#v != %#v", frames, expected)
+	}
+}
+
+func TestScanSyslogFramesRejectsOversizedFrame(t *testing.T) {
+	r := strings.NewReader("10 hi")
+	err := scanSyslogFrames(r, 2, func([]byte, int64) {})
+	if err == nil {
+		t.Error("Expected an error when MSG-LEN exceeds MaxFrameBytes")
+	}
+}
@@ -0,0 +1,134 @@
+package logtap
+
+import "sync"
+
+// OverflowPolicy controls what a Pipeline does when its queue is full
+// and a new batch arrives faster than its workers can drain it.
+type OverflowPolicy int
+
+const (
+	// Block makes Submit wait until the queue has room. This
+	// preserves every batch but, unlike the other policies, can still
+	// stall the caller under sustained overload.
+	Block OverflowPolicy = iota
+	// DropOldest evicts the oldest queued batch to make room for the
+	// new one, so Submit never blocks. It rejects the new batch only if
+	// the queue is still full after the eviction (e.g. another Submit
+	// took the freed slot first).
+	DropOldest
+	// DropNewest rejects the incoming batch, leaving the queue as is.
+	DropNewest
+	// RejectWith503 behaves like DropNewest; Handler uses it as the
+	// signal to answer the HTTP request with 503 instead of 202.
+	RejectWith503
+)
+
+// job is one batch queued for a Pipeline's workers.
+type job struct {
+	messages []*SyslogMessage
+	ctx      interface{}
+}
+
+// A Pipeline runs f on a bounded pool of worker goroutines instead of
+// on the caller's goroutine, so a slow or bursty f can't stall whoever
+// is producing batches (for Handler, the HTTP request goroutine, and
+// by extension Logplex's retries) or grow goroutine count unbounded.
+//
+// Submit satisfies the same contract as the F field of Handler and
+// Listener (func([]*SyslogMessage, interface{})) via SubmitFunc, so a
+// Pipeline can be dropped in wherever an F is expected. Handler also
+// accepts a Pipeline directly via its Pipeline field, in which case it
+// uses Submit's return value to choose the HTTP response status
+// instead of ignoring it.
+//
+// Pipeline reports its operational state via Telemetry, which defaults
+// to LogTelemetry.
+type Pipeline struct {
+	Telemetry
+	Overflow OverflowPolicy
+
+	queue chan job
+	wg    sync.WaitGroup
+}
+
+// NewPipeline creates a Pipeline with the given number of worker
+// goroutines and queue capacity, each worker invoking f for every
+// batch it dequeues. Overflow defaults to Block; set Pipeline.Overflow
+// to change it.
+func NewPipeline(workers, queueSize int, f func([]*SyslogMessage, interface{})) *Pipeline {
+	p := &Pipeline{
+		Telemetry: LogTelemetry,
+		queue:     make(chan job, queueSize),
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work(f)
+	}
+	return p
+}
+
+func (p *Pipeline) work(f func([]*SyslogMessage, interface{})) {
+	defer p.wg.Done()
+	for j := range p.queue {
+		f(j.messages, j.ctx)
+	}
+}
+
+// Submit enqueues messages and ctx for processing by a worker,
+// applying Overflow if the queue is full. It returns whether the batch
+// was queued (for Block, always true); under DropOldest a queued batch
+// may still be evicted later by another Submit. DropNewest and
+// RejectWith503 return false whenever the queue is full, DropOldest only
+// when it cannot free a slot for the batch.
+func (p *Pipeline) Submit(messages []*SyslogMessage, ctx interface{}) bool {
+	p.Value(len(p.queue), "queue depth")
+	select {
+	case p.queue <- job{messages, ctx}:
+		return true
+	default:
+	}
+
+	// The queue was full: every worker is busy, or processing is
+	// lagging behind arrivals.
+	p.Count(1, "worker busy")
+	switch p.Overflow {
+	case DropOldest:
+		select {
+		case <-p.queue:
+			p.Count(1, "dropped")
+		default:
+		}
+		select {
+		case p.queue <- job{messages, ctx}:
+			return true
+		default:
+			// The queue is full again (another Submit won the race for
+			// the freed slot); give up rather than risk blocking.
+			p.Count(1, "dropped")
+			return false
+		}
+	case DropNewest, RejectWith503:
+		p.Count(1, "dropped")
+		return false
+	default: // Block
+		p.queue <- job{messages, ctx}
+		return true
+	}
+}
+
+// SubmitFunc returns a func([]*SyslogMessage, interface{}) that calls
+// Submit, discarding its return value, so a Pipeline can be used
+// anywhere an F is expected (e.g. Handler.F, Listener.F).
+func (p *Pipeline) SubmitFunc() func([]*SyslogMessage, interface{}) {
+	return func(messages []*SyslogMessage, ctx interface{}) {
+		p.Submit(messages, ctx)
+	}
+}
+
+// Close stops accepting new work and waits for every in-flight and
+// already-queued batch to be processed by a worker. Submit must not be
+// called again after Close.
+func (p *Pipeline) Close() {
+	close(p.queue)
+	p.wg.Wait()
+}
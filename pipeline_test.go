@@ -0,0 +1,99 @@
+package logtap
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPipelineProcessesSubmittedBatches(t *testing.T) {
+	var n int64
+	var wg sync.WaitGroup
+	wg.Add(3)
+	p := NewPipeline(2, 4, func(messages []*SyslogMessage, ctx interface{}) {
+		atomic.AddInt64(&n, int64(len(messages)))
+		wg.Done()
+	})
+	p.Telemetry = DiscardTelemetry
+	for i := 0; i < 3; i++ {
+		if !p.Submit([]*SyslogMessage{{}}, nil) {
+			t.Fatal("Submit unexpectedly rejected under Block policy")
+		}
+	}
+	wg.Wait()
+	p.Close()
+	if n != 3 {
+		t.Errorf("Expected 3 messages processed, got %v", n)
+	}
+}
+
+func TestPipelineDropNewest(t *testing.T) {
+	block := make(chan struct{})
+	p := NewPipeline(1, 1, func(messages []*SyslogMessage, ctx interface{}) {
+		<-block
+	})
+	p.Telemetry = DiscardTelemetry
+	p.Overflow = DropNewest
+	if !p.Submit(nil, nil) {
+		t.Fatal("Expected the first Submit to be accepted into the idle worker")
+	}
+	// Give the worker a moment to pick up the first batch so the queue
+	// (capacity 1) is the only thing left to fill.
+	time.Sleep(10 * time.Millisecond)
+	if !p.Submit(nil, nil) {
+		t.Fatal("Expected the second Submit to fill the queue")
+	}
+	if p.Submit(nil, nil) {
+		t.Error("Expected the third Submit to be rejected once the queue is full")
+	}
+	close(block)
+	p.Close()
+}
+
+func TestPipelineSubmitFunc(t *testing.T) {
+	done := make(chan struct{})
+	p := NewPipeline(1, 1, func(messages []*SyslogMessage, ctx interface{}) {
+		close(done)
+	})
+	p.Telemetry = DiscardTelemetry
+	f := p.SubmitFunc()
+	f(nil, nil)
+	<-done
+	p.Close()
+}
+
+// BenchmarkHandlerSync and BenchmarkHandlerPipeline compare the
+// synchronous h.F call path against a Pipeline-backed one when F is
+// slow, simulating a consumer that can't keep up with Logplex's
+// delivery rate.
+func benchmarkSlowF(b *testing.B, pipeline *Pipeline) {
+	slow := func([]*SyslogMessage, interface{}) {
+		time.Sleep(time.Millisecond)
+	}
+	var submit func([]*SyslogMessage, interface{})
+	if pipeline != nil {
+		pipeline.Telemetry = DiscardTelemetry
+		submit = pipeline.SubmitFunc()
+	} else {
+		submit = slow
+	}
+	msgs := []*SyslogMessage{{}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		submit(msgs, nil)
+	}
+	if pipeline != nil {
+		pipeline.Close()
+	}
+}
+
+func BenchmarkHandlerSync(b *testing.B) {
+	benchmarkSlowF(b, nil)
+}
+
+func BenchmarkHandlerPipeline(b *testing.B) {
+	benchmarkSlowF(b, NewPipeline(16, 1024, func([]*SyslogMessage, interface{}) {
+		time.Sleep(time.Millisecond)
+	}))
+}
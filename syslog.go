@@ -3,17 +3,19 @@ package logtap
 import (
 	"bufio"
 	"bytes"
+	"encoding/hex"
 	"errors"
 	"io"
+	"log/slog"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 	"unicode/utf8"
 )
 
 // SyslogMessage type represents a parsed syslog message as defined by
-// RFC5424. Caveat: it lacks "structured data" part because Heroku
-// Logplex doesn't include it in HTTP requests it sends.
+// RFC5424.
 //
 // See: http://tools.ietf.org/html/rfc5424#section-6
 type SyslogMessage struct {
@@ -24,8 +26,14 @@ type SyslogMessage struct {
 	Appname   string
 	Procid    string
 	Msgid     string
-	Text      string
-	// Heroku syslog data lacks STRUCTURED-DATA piece (which should be between Msgid and Text)
+	// StructuredData holds the SD-ELEMENTs keyed by SD-ID, each mapping
+	// PARAM-NAME to its (unescaped) PARAM-VALUE. It is nil when the
+	// message's STRUCTURED-DATA is the "-" NILVALUE or is omitted
+	// altogether, which is what Heroku Logplex has historically done;
+	// drains forwarding RFC5424-compliant SD-ELEMENTs (logfwd,
+	// logshuttle, sidecar agents) populate it.
+	StructuredData map[string]map[string]string
+	Text           string
 }
 
 // ensureUtf8 produces a valid utf-8 encoded string. In case its input is
@@ -68,6 +76,102 @@ var syslogMessagePattern = regexp.MustCompile(`^<(.+?)>(.+?) (.+?) (.+?) (.+?) (
 // syslog message pattern.
 var ErrSyslogPatternMismatch = errors.New("syslog message pattern mismatch")
 
+// utf8BOM is the byte sequence RFC5424 section 6.4 says MAY precede the
+// MSG part; when present it must be stripped before Text is assigned.
+const utf8BOM = "\xef\xbb\xbf"
+
+// parseSDElements parses one or more RFC5424 section 6.3 SD-ELEMENTs
+// ("[SD-ID PARAM-NAME=\"PARAM-VALUE\" ...]...") from the front of s,
+// where PARAM-VALUE escapes '"', '\' and ']' with a leading '\'. It
+// returns the parsed elements, whatever follows them, and whether s
+// actually started with a well-formed SD-ELEMENT sequence.
+//
+// Every SD-ELEMENT must carry at least one PARAM, as genuine
+// logfwd/logshuttle SD-ELEMENTs always do; a param-less "[word]" is
+// rejected (ok = false) rather than accepted as SD, since that shape is
+// indistinguishable from a bracketed level/tag prefix on an ordinary
+// MSG (e.g. "[info] starting server", "[GIN] ...").
+func parseSDElements(s string) (sd map[string]map[string]string, rest string, ok bool) {
+	sd = make(map[string]map[string]string)
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		i++
+		idStart := i
+		for i < len(s) && s[i] != ' ' && s[i] != ']' {
+			i++
+		}
+		if i >= len(s) || i == idStart {
+			return nil, "", false
+		}
+		id := s[idStart:i]
+		params := make(map[string]string)
+		for i < len(s) && s[i] == ' ' {
+			i++
+			nameStart := i
+			for i < len(s) && s[i] != '=' {
+				i++
+			}
+			if i >= len(s) || i == nameStart {
+				return nil, "", false
+			}
+			name := s[nameStart:i]
+			i++ // skip '='
+			if i >= len(s) || s[i] != '"' {
+				return nil, "", false
+			}
+			i++ // skip opening quote
+			var value bytes.Buffer
+			for i < len(s) && s[i] != '"' {
+				if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+					value.WriteByte(s[i+1])
+					i += 2
+					continue
+				}
+				value.WriteByte(s[i])
+				i++
+			}
+			if i >= len(s) {
+				return nil, "", false
+			}
+			i++ // skip closing quote
+			params[name] = value.String()
+		}
+		if i >= len(s) || s[i] != ']' {
+			return nil, "", false
+		}
+		if len(params) == 0 {
+			return nil, "", false
+		}
+		sd[id] = params
+		i++
+	}
+	return sd, s[i:], true
+}
+
+// parseStructuredData splits the STRUCTURED-DATA and MSG parts out of
+// s, the tail of a syslog message following MSGID. Heroku Logplex has
+// historically omitted STRUCTURED-DATA altogether rather than sending
+// its "-" NILVALUE, so s is only treated as STRUCTURED-DATA when it
+// actually looks like one: a standalone "-" with nothing following it,
+// or a well-formed SD-ELEMENT sequence. Anything else -- including a
+// "-" followed by more text, which on the Heroku ingest path is just a
+// MSG that happens to start with "- " (a markdown bullet, a diff
+// removal line, a YAML sequence item, ...) -- is assumed to be a MSG
+// with no preceding STRUCTURED-DATA, which keeps legacy Heroku
+// messages parsing exactly as before.
+func parseStructuredData(s string) (map[string]map[string]string, string) {
+	if s == "-" {
+		return nil, ""
+	}
+	if len(s) == 0 || s[0] != '[' {
+		return nil, s
+	}
+	if sd, rest, ok := parseSDElements(s); ok {
+		return sd, strings.TrimPrefix(rest, " ")
+	}
+	return nil, s
+}
+
 // ParseSyslogMessage parses a slice of bytes containing syslog
 // message.
 func ParseSyslogMessage(b []byte) (*SyslogMessage, error) {
@@ -80,6 +184,7 @@ func ParseSyslogMessage(b []byte) (*SyslogMessage, error) {
 	if err != nil {
 		return nil, err
 	}
+	sd, text := parseStructuredData(match[8])
 	m := SyslogMessage{}
 	m.Priority = match[1]
 	m.Version = match[2]
@@ -88,7 +193,8 @@ func ParseSyslogMessage(b []byte) (*SyslogMessage, error) {
 	m.Appname = match[5]
 	m.Procid = match[6]
 	m.Msgid = match[7]
-	m.Text = match[8]
+	m.StructuredData = sd
+	m.Text = strings.TrimPrefix(text, utf8BOM)
 	return &m, nil
 }
 
@@ -107,6 +213,20 @@ func tokenize(data []byte, atEOF bool) (int, []byte, error) {
 	return 0, nil, nil
 }
 
+// hexPreviewBytes bounds how much of an unparseable frame gets copied
+// into a log record.
+const hexPreviewBytes = 32
+
+// hexPreview renders at most hexPreviewBytes of b as a hex string,
+// suitable for attaching to a log record without risking logging an
+// entire (potentially huge) malformed frame.
+func hexPreview(b []byte) string {
+	if len(b) > hexPreviewBytes {
+		b = b[:hexPreviewBytes]
+	}
+	return hex.EncodeToString(b)
+}
+
 // ReadSyslogMessages returns a slice of scanned syslog messages from
 // the specified reader using the syslog TCP protocol octet counting
 // framing method. It appends messages to the specified slice,
@@ -115,16 +235,37 @@ func tokenize(data []byte, atEOF bool) (int, []byte, error) {
 // also returns a potentially non-empty slice of errors that might
 // have occurred during scanning.
 //
+// Each parse failure is also logged to logger at LevelWarn, with the
+// byte offset of the offending frame within r and a truncated hex
+// preview of its contents. If logger is nil, slog.Default() is used.
+//
 // See the spec: http://tools.ietf.org/html/draft-gerhards-syslog-plain-tcp-12#section-3.4.1
-func ReadSyslogMessages(results []*SyslogMessage, r io.Reader) ([]*SyslogMessage, []error) {
+func ReadSyslogMessages(results []*SyslogMessage, r io.Reader, logger *slog.Logger) ([]*SyslogMessage, []error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
 	var errors []error
+	var offset, frameOffset int64
 	s := bufio.NewScanner(r)
-	s.Split(tokenize)
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := tokenize(data, atEOF)
+		if token != nil {
+			frameOffset = offset
+		}
+		offset += int64(advance)
+		return advance, token, err
+	})
 	for s.Scan() {
-		if m, err := ParseSyslogMessage(s.Bytes()); err == nil {
+		frame := s.Bytes()
+		if m, err := ParseSyslogMessage(frame); err == nil {
 			results = append(results, m)
 		} else {
 			errors = append(errors, err)
+			logger.Warn("syslog message parse error",
+				"err", err,
+				"frame_offset", frameOffset,
+				"frame_preview", hexPreview(frame),
+			)
 		}
 	}
 	if err := s.Err(); err != nil {
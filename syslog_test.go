@@ -3,6 +3,7 @@ package logtap
 import (
 	"bytes"
 	"fmt"
+	"log/slog"
 	"reflect"
 	"strings"
 	"testing"
@@ -47,6 +48,113 @@ func TestParseSyslogMessage(t *testing.T) {
 	}
 }
 
+func TestParseSyslogMessageStructuredData(t *testing.T) {
+	m, err := ParseSyslogMessage([]byte(
+		`<45>1 2014-01-09T20:34:44.651004+00:00 host heroku api - ` +
+			`[exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"]` +
+			`[exampleSDID@32480 class="high" tag="a\]b" note="say \"hi\"" path="c:\\tmp"] ` +
+			`An application event log entry`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]map[string]string{
+		"exampleSDID@32473": {"iut": "3", "eventSource": "Application", "eventID": "1011"},
+		"exampleSDID@32480": {"class": "high", "tag": "a]b", "note": `say "hi"`, "path": `c:\tmp`},
+	}
+	if !reflect.DeepEqual(m.StructuredData, expected) {
+		t.Errorf("%#v != %#v", m.StructuredData, expected)
+	}
+	if m.Text != "An application event log entry" {
+		t.Errorf("Unexpected Text: %q", m.Text)
+	}
+}
+
+func TestParseSyslogMessageStructuredDataNilValue(t *testing.T) {
+	// A standalone "-" tail (nothing after it) is unambiguously the
+	// STRUCTURED-DATA NILVALUE, since a real MSG can't be empty and
+	// trail a bare "-".
+	m, err := ParseSyslogMessage([]byte(
+		"<45>1 2014-01-09T20:34:44.651004+00:00 host heroku api - -"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.StructuredData != nil {
+		t.Errorf("Expected nil StructuredData, got %#v", m.StructuredData)
+	}
+	if m.Text != "" {
+		t.Errorf("Unexpected Text: %q", m.Text)
+	}
+}
+
+func TestParseSyslogMessageDoesNotStripLeadingDashFromMsg(t *testing.T) {
+	// A "-" followed by more text is just an ordinary MSG that starts
+	// with "- " (a markdown bullet, a diff removal line, a YAML
+	// sequence item, ...) on the Heroku ingest path, which never sends
+	// the NILVALUE. It must not be mistaken for STRUCTURED-DATA and
+	// have its "- " prefix stripped.
+	m, err := ParseSyslogMessage([]byte(
+		"<45>1 2014-01-09T20:34:44.651004+00:00 host heroku api - - removed line"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.StructuredData != nil {
+		t.Errorf("Expected nil StructuredData, got %#v", m.StructuredData)
+	}
+	if m.Text != "- removed line" {
+		t.Errorf("Unexpected Text: %q", m.Text)
+	}
+}
+
+func TestParseSyslogMessageBracketedLevelTagIsNotStructuredData(t *testing.T) {
+	m, err := ParseSyslogMessage([]byte(
+		"<45>1 2014-01-09T20:34:44.651004+00:00 host heroku api - [info] foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.StructuredData != nil {
+		t.Errorf("Expected nil StructuredData, got %#v", m.StructuredData)
+	}
+	if m.Text != "[info] foo" {
+		t.Errorf("Unexpected Text: %q", m.Text)
+	}
+}
+
+func TestParseSyslogMessageBOM(t *testing.T) {
+	m, err := ParseSyslogMessage([]byte(
+		"<45>1 2014-01-09T20:34:44.651004+00:00 host heroku api - \xef\xbb\xbfhello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Text != "hello" {
+		t.Errorf("Expected BOM to be stripped, got %q", m.Text)
+	}
+}
+
+func TestParseSDElementsQuickCheck(t *testing.T) {
+	// property: any param value we encode (with required escaping)
+	// round-trips back out of parseSDElements unchanged, regardless of
+	// what characters it contains, under any SD-ID and PARAM-NAME free
+	// of space, brackets, '=' and '"'.
+	f := func(id string, name string, value string) bool {
+		if id == "" || name == "" {
+			return true
+		}
+		if strings.ContainsAny(id, " []=\"") || strings.ContainsAny(name, " []=\"") {
+			return true
+		}
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+		s := fmt.Sprintf(`[%s %s="%s"] rest`, id, name, escaped)
+		sd, rest, ok := parseSDElements(s)
+		if !ok {
+			return false
+		}
+		return rest == " rest" && reflect.DeepEqual(sd, map[string]map[string]string{id: {name: value}})
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestTokenize(t *testing.T) {
 	advance, data, err := tokenize(nil, true)
 	if advance != 0 || data != nil || err != nil {
@@ -71,7 +179,7 @@ func TestTokenize(t *testing.T) {
 func testReadInvalidSyslogMessages(t *testing.T) {
 	f := func(b []byte) bool {
 		// property: totally random byte input will never produce messages.
-		xs, _ := ReadSyslogMessages(nil, bytes.NewBuffer(b))
+		xs, _ := ReadSyslogMessages(nil, bytes.NewBuffer(b), nil)
 		if len(xs) != 0 {
 			t.Errorf("Got %v unexpected syslog messages", len(xs))
 			return false
@@ -108,7 +216,7 @@ func TestReadSyslogMessages(t *testing.T) {
 	actual, errors := ReadSyslogMessages(nil, strings.NewReader(
 		`95 <45>1 2014-01-09T20:34:44.651004+00:00 host heroku api - Add ZOMGZOMG config by foo@example.com`+
 			`97 <45>1 2014-01-09T20:34:44.693891+00:00 host heroku api - Release v1822 created by foo@example.com`+
-			`zomg bogus`))
+			`zomg bogus`), nil)
 	if len(actual) != len(expected) {
 		t.Errorf("Unexpected number of results: %v", len(actual))
 	}
@@ -119,3 +227,22 @@ func TestReadSyslogMessages(t *testing.T) {
 		t.Errorf("Unexpected number of errors: %v", len(errors))
 	}
 }
+
+func TestReadSyslogMessagesLogsParseErrors(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(buf, nil))
+	_, errors := ReadSyslogMessages(nil, strings.NewReader(`9 bogus!!!!`), logger)
+	if len(errors) != 1 {
+		t.Fatalf("Unexpected number of errors: %v", len(errors))
+	}
+	out := buf.String()
+	if !strings.Contains(out, "level=WARN") {
+		t.Error("Expected parse error to be logged at WARN level, got:", out)
+	}
+	if !strings.Contains(out, "frame_offset=0") {
+		t.Error("Expected frame_offset attribute, got:", out)
+	}
+	if !strings.Contains(out, "frame_preview=") {
+		t.Error("Expected frame_preview attribute, got:", out)
+	}
+}
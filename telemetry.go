@@ -10,6 +10,12 @@ import (
 type Telemetry interface {
 	Value(value interface{}, name string)
 	Count(value int, name string)
+
+	// With returns a Telemetry that annotates every subsequent Value
+	// and Count call with the given tags. tags is a flat list of
+	// alternating key, value pairs, e.g. With("app", "web", "host", "foo").
+	// A trailing unpaired key is ignored.
+	With(tags ...string) Telemetry
 }
 
 type discardTelemetry struct{}
@@ -19,8 +25,11 @@ var DiscardTelemetry = &discardTelemetry{}
 
 func (*discardTelemetry) Value(value interface{}, name string) {}
 func (*discardTelemetry) Count(value int, name string)         {}
+func (t *discardTelemetry) With(tags ...string) Telemetry      { return t }
 
-type logTelemetry struct{}
+type logTelemetry struct {
+	tags []string
+}
 
 // LogTelemetry sends telemetry to the standard logger.
 //
@@ -28,9 +37,30 @@ type logTelemetry struct{}
 //
 //     LogTelemetry.Count(33, "beans")  // prints `APP_METRIC {"stat": "beans", "count": 33}`
 //     LogTelemetry.Value(36.6, "temp") // prints `APP_METRIC {"stat": "temp", "value": 36.6}`
+//     LogTelemetry.With("app", "web").Count(1, "beans")
+//         // prints `APP_METRIC {"stat": "beans", "count": 1, "tags": {"app":"web"}}`
 var LogTelemetry = &logTelemetry{}
 
-func printAppMetric(key string, value interface{}, name string) {
+// With returns a logTelemetry that carries t's tags plus the given
+// ones, so tags accumulate across nested calls.
+func (t *logTelemetry) With(tags ...string) Telemetry {
+	combined := make([]string, 0, len(t.tags)+len(tags))
+	combined = append(combined, t.tags...)
+	combined = append(combined, tags...)
+	return &logTelemetry{tags: combined}
+}
+
+// tagsMap turns a flat key, value, key, value... list into a map,
+// dropping a trailing unpaired key.
+func tagsMap(tags []string) map[string]string {
+	m := make(map[string]string, len(tags)/2)
+	for i := 0; i+1 < len(tags); i += 2 {
+		m[tags[i]] = tags[i+1]
+	}
+	return m
+}
+
+func printAppMetric(tags []string, key string, value interface{}, name string) {
 	var v, n []byte
 	switch value.(type) {
 	case float32, float64,
@@ -41,13 +71,18 @@ func printAppMetric(key string, value interface{}, name string) {
 		return
 	}
 	n, _ = json.Marshal(name)
-	log.Print(fmt.Sprintf(`APP_METRIC {"stat": %s, "%s": %s}`, n, key, v))
+	if len(tags) == 0 {
+		log.Print(fmt.Sprintf(`APP_METRIC {"stat": %s, "%s": %s}`, n, key, v))
+		return
+	}
+	t, _ := json.Marshal(tagsMap(tags))
+	log.Print(fmt.Sprintf(`APP_METRIC {"stat": %s, "%s": %s, "tags": %s}`, n, key, v, t))
 }
 
-func (*logTelemetry) Value(value interface{}, name string) {
-	printAppMetric("value", value, name)
+func (t *logTelemetry) Value(value interface{}, name string) {
+	printAppMetric(t.tags, "value", value, name)
 }
 
-func (*logTelemetry) Count(value int, name string) {
-	printAppMetric("count", value, name)
+func (t *logTelemetry) Count(value int, name string) {
+	printAppMetric(t.tags, "count", value, name)
 }
@@ -34,3 +34,24 @@ func TestLogTelemetry(t *testing.T) {
 		t.Errorf("%#v != %#v", actual, expected)
 	}
 }
+
+func TestLogTelemetryWith(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log.SetFlags(0)
+	log.SetOutput(buf)
+	LogTelemetry.With("app", "web").With("host", "foo").Count(1, "beans")
+	s := bufio.NewScanner(buf)
+	if !s.Scan() {
+		t.Fatal("Expected a log line")
+	}
+	expected := `APP_METRIC {"stat": "beans", "count": 1, "tags": {"app":"web","host":"foo"}}`
+	if s.Text() != expected {
+		t.Errorf("%#v != %#v", s.Text(), expected)
+	}
+}
+
+func TestDiscardTelemetryWith(t *testing.T) {
+	if DiscardTelemetry.With("a", "b") != DiscardTelemetry {
+		t.Error("Expected DiscardTelemetry.With to return itself")
+	}
+}